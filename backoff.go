@@ -0,0 +1,82 @@
+package chanserv
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// ServerOption configures optional behaviour of a Server implementation.
+// Concrete Server implementations that accept ServerOptions should document
+// which of these they honour.
+type ServerOption func(*serverOptions)
+
+type serverOptions struct {
+	onAcceptDelay    func(time.Duration)
+	discovery        Discovery
+	discoveryService string
+	codecs           map[string]codec
+}
+
+// WithAcceptDelayMetric registers fn to be called with the current accept-retry
+// delay every time handleAcceptErr computes a non-zero one, so it can be
+// exported as a metric.
+func WithAcceptDelayMetric(fn func(time.Duration)) ServerOption {
+	return func(o *serverOptions) { o.onAcceptDelay = fn }
+}
+
+func newServerOptions(opts ...ServerOption) *serverOptions {
+	o := &serverOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+const (
+	acceptErrDelayInit      = 5 * time.Millisecond
+	acceptErrDelayTemporary = time.Second
+	acceptErrDelayPermanent = 5 * time.Second
+)
+
+// nextAcceptDelay computes the next retry delay for the hardened Accept-loop
+// pattern, given the previous delay (0 on the first error after a successful
+// Accept): it doubles, capped at acceptErrDelayTemporary for a net.Error with
+// Temporary() == true, or at acceptErrDelayPermanent for anything else.
+func nextAcceptDelay(err error, delay time.Duration) time.Duration {
+	max := acceptErrDelayPermanent
+	if nerr, ok := err.(net.Error); ok && nerr.Temporary() {
+		max = acceptErrDelayTemporary
+	}
+	if delay == 0 {
+		delay = acceptErrDelayInit
+	} else {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// handleAcceptErr implements the hardened Accept-loop pattern: it computes
+// the next delay via nextAcceptDelay, reports it through the optional
+// metrics callback, and sleeps for it, returning early with ctx.Err() if ctx
+// is cancelled first. delay should be reset to zero by the caller after a
+// successful Accept.
+func handleAcceptErr(ctx context.Context, err error, delay time.Duration, onDelay func(time.Duration)) (time.Duration, error) {
+	delay = nextAcceptDelay(err, delay)
+
+	if onDelay != nil {
+		onDelay(delay)
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return delay, nil
+	case <-ctx.Done():
+		return delay, ctx.Err()
+	}
+}
@@ -0,0 +1,84 @@
+package chanserv
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeNetErr struct{ temporary bool }
+
+func (e fakeNetErr) Error() string   { return "fake net error" }
+func (e fakeNetErr) Timeout() bool   { return false }
+func (e fakeNetErr) Temporary() bool { return e.temporary }
+
+func TestNextAcceptDelayDoublesAndCapsTemporary(t *testing.T) {
+	var delay time.Duration
+	for i := 0; i < 20; i++ {
+		delay = nextAcceptDelay(fakeNetErr{temporary: true}, delay)
+		if delay > acceptErrDelayTemporary {
+			t.Fatalf("delay %v exceeded temporary cap %v", delay, acceptErrDelayTemporary)
+		}
+	}
+	if delay != acceptErrDelayTemporary {
+		t.Fatalf("expected delay to converge to %v, got %v", acceptErrDelayTemporary, delay)
+	}
+}
+
+func TestNextAcceptDelayDoublesAndCapsPermanent(t *testing.T) {
+	var delay time.Duration
+	for i := 0; i < 20; i++ {
+		delay = nextAcceptDelay(errors.New("boom"), delay)
+		if delay > acceptErrDelayPermanent {
+			t.Fatalf("delay %v exceeded permanent cap %v", delay, acceptErrDelayPermanent)
+		}
+	}
+	if delay != acceptErrDelayPermanent {
+		t.Fatalf("expected delay to converge to %v, got %v", acceptErrDelayPermanent, delay)
+	}
+}
+
+func TestNextAcceptDelayStartsAtInitDelay(t *testing.T) {
+	if delay := nextAcceptDelay(errors.New("boom"), 0); delay != acceptErrDelayInit {
+		t.Fatalf("expected initial delay %v, got %v", acceptErrDelayInit, delay)
+	}
+}
+
+func TestNextAcceptDelayResetAfterSuccessStartsOver(t *testing.T) {
+	delay := nextAcceptDelay(errors.New("boom"), 500*time.Millisecond)
+	if delay != time.Second {
+		t.Fatalf("expected doubling from 500ms to reach 1s, got %v", delay)
+	}
+	// A successful Accept resets delay to 0 before the next error.
+	delay = nextAcceptDelay(errors.New("boom"), 0)
+	if delay != acceptErrDelayInit {
+		t.Fatalf("expected reset delay to restart at %v, got %v", acceptErrDelayInit, delay)
+	}
+}
+
+func TestHandleAcceptErrHonoursContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := handleAcceptErr(ctx, errors.New("boom"), 0, nil); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestHandleAcceptErrReportsMetricAndSleeps(t *testing.T) {
+	var got time.Duration
+	start := time.Now()
+	delay, err := handleAcceptErr(context.Background(), errors.New("boom"), 0, func(d time.Duration) { got = d })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if delay != acceptErrDelayInit {
+		t.Fatalf("expected delay %v, got %v", acceptErrDelayInit, delay)
+	}
+	if got != acceptErrDelayInit {
+		t.Fatalf("expected metric callback to see %v, got %v", acceptErrDelayInit, got)
+	}
+	if elapsed := time.Since(start); elapsed < acceptErrDelayInit {
+		t.Fatalf("handleAcceptErr returned after %v, expected to sleep at least %v", elapsed, acceptErrDelayInit)
+	}
+}
@@ -2,6 +2,7 @@
 package chanserv
 
 import (
+	"context"
 	"net"
 	"time"
 )
@@ -41,6 +42,22 @@ type Source interface {
 // on the client side it will be closed by chanserv upon a network/timeout error or success on the remote side.
 type SourceFunc func(reqBody []byte) <-chan Source
 
+// SourceCtxFunc is the context-aware variant of SourceFunc used by ServeContext.
+// The provided ctx is cancelled once the requesting client disconnects or the
+// server is shutting down, so long-lived frame producers can abort early instead
+// of blocking on a send that will never be received.
+type SourceCtxFunc func(ctx context.Context, reqBody []byte) <-chan Source
+
+// ErrSource is a Source returned by the context-aware APIs. Once Out() closes,
+// Err reports why: nil on a clean EOF from the remote side, ctx.Err() if the
+// caller's context was cancelled first, or the underlying network error.
+type ErrSource interface {
+	Source
+	// Err returns the reason Out() was closed. It is only meaningful to call
+	// after a receive on Out() has returned with ok == false.
+	Err() error
+}
+
 // Multiplexer can be any muxer that is able to bind to some address and dial some address.
 // Chanserv assumes this would be the AstraNet multiplexer that can handle millions of streams.
 type Multiplexer interface {
@@ -52,6 +69,14 @@ type Server interface {
 	// ListenAndServe starts to listen incomming connections on vAddr,
 	// and emits frame sources using the provided SourceFunc.
 	ListenAndServe(vAddr string, src SourceFunc) error
+	// ServeContext is the context-aware variant of ListenAndServe. The accept
+	// loop and every in-flight subscription stop as soon as ctx is cancelled:
+	// src is invoked with a child context that is cancelled alongside it, and
+	// any Source.Out() channels still open at that point are closed. ServeContext
+	// returns ctx.Err() once shutdown completes, or the error from binding vAddr
+	// (or registering with a configured Discovery) if that happened first.
+	// Errors from Accept are retried with backoff and are not returned.
+	ServeContext(ctx context.Context, vAddr string, src SourceCtxFunc) error
 }
 
 // RequestTag allows to specify additional options of a client's request.
@@ -62,6 +87,10 @@ const (
 	// TagBucket specifies the bucket hash for the hash-based balancing algorithm.
 	// Use this if your multiplexer can dial hosts with taking a hash into account.
 	TagBucket
+	// TagCodecPreference holds a comma-separated, most-preferred-first list of
+	// codec names (e.g. "zstd,gzip") negotiated during subscription setup. See
+	// WithFrameCodec.
+	TagCodecPreference
 )
 
 type Client interface {
@@ -70,4 +99,23 @@ type Client interface {
 	// request params. Returns a new source subscribtion or error if any. The subscription channel will be closed
 	// upon network error or success on the remote side.
 	LookupAndPost(vAddr string, body []byte, tags map[RequestTag]string) (<-chan Source, error)
+	// LookupAndPostContext is the context-aware variant of LookupAndPost. Cancelling
+	// ctx tears down the dial/subscription and closes the returned channel; the
+	// yielded ErrSource.Err() then reports ctx.Err() instead of nil or a network error.
+	// If tags[TagHedge] requests more than one attempt, vAddr may be a
+	// comma-separated list of candidate addresses to actually fan the attempts
+	// out to distinct backends; see TagHedge's doc for details.
+	LookupAndPostContext(ctx context.Context, vAddr string, body []byte, tags map[RequestTag]string) (<-chan ErrSource, error)
+	// LookupAndPostContextWithSubscription is the hedge-aware variant of
+	// LookupAndPostContext: alongside the channel, it returns a *Subscription
+	// reporting which attempt won and the errors observed from the attempts
+	// that lost. The Subscription is only safe to read once the channel has
+	// been drained to closed; reading it earlier races with in-flight
+	// attempts. For a request that did not hedge (tags[TagHedge] <= 1), it
+	// returns a nil Subscription, since there is only ever one attempt.
+	LookupAndPostContextWithSubscription(ctx context.Context, vAddr string, body []byte, tags map[RequestTag]string) (<-chan ErrSource, *Subscription, error)
+	// LookupService resolves name against the Client's configured Discovery
+	// backend and streams matching Endpoints, suitable for feeding their VAddr
+	// into LookupAndPost. The channel is closed when ctx is cancelled.
+	LookupService(ctx context.Context, name string) (<-chan Endpoint, error)
 }
@@ -0,0 +1,323 @@
+package chanserv
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultDialTimeout bounds how long LookupAndPost(Context) waits for the
+// Multiplexer to hand back a connection.
+const defaultDialTimeout = 5 * time.Second
+
+// ClientOption configures optional behaviour of a Client implementation. It
+// is the same functional-options type as ServerOption so a single With*
+// helper (e.g. WithFrameCodec, WithDiscovery) can configure either.
+type ClientOption = ServerOption
+
+// netClient is the concrete Client implementation: it dials vAddr on a
+// Multiplexer, performs the subscribeRequest handshake, and reconstructs
+// Sources from the wireMsg stream the server sends back.
+type netClient struct {
+	mux  Multiplexer
+	opts *serverOptions
+}
+
+// NewClient returns a Client backed by mux. See the With* options in this
+// package for optional behaviour (frame codecs, service discovery).
+func NewClient(mux Multiplexer, opts ...ClientOption) Client {
+	return &netClient{mux: mux, opts: newServerOptions(opts...)}
+}
+
+func (c *netClient) LookupAndPost(vAddr string, body []byte, tags map[RequestTag]string) (<-chan Source, error) {
+	ch, err := c.LookupAndPostContext(context.Background(), vAddr, body, tags)
+	if err != nil {
+		return nil, err
+	}
+	return errSourceChan(ch), nil
+}
+
+func (c *netClient) LookupAndPostContext(ctx context.Context, vAddr string, body []byte, tags map[RequestTag]string) (<-chan ErrSource, error) {
+	ch, _, err := c.LookupAndPostContextWithSubscription(ctx, vAddr, body, tags)
+	return ch, err
+}
+
+func (c *netClient) LookupAndPostContextWithSubscription(ctx context.Context, vAddr string, body []byte, tags map[RequestTag]string) (<-chan ErrSource, *Subscription, error) {
+	n := hedgeCount(tags)
+	if n <= 1 {
+		ch, err := c.dialAndSubscribe(ctx, vAddr, body, tags)
+		return ch, nil, err
+	}
+	return c.hedgedDialAndSubscribe(ctx, vAddr, body, tags, n)
+}
+
+// hedgedDialAndSubscribe implements the TagHedge contract: it dials n
+// candidates (vAddr split on comma, cycling through the list if fewer than n
+// addresses were given — see TagHedge's doc for why a single vAddr does not
+// by itself land on distinct backends) via mergeSources, tagging each
+// attempt's subscription request with its index via TagBucket. The first
+// attempt to yield a Source wins and the rest are cancelled.
+func (c *netClient) hedgedDialAndSubscribe(ctx context.Context, vAddr string, body []byte, tags map[RequestTag]string, n int) (<-chan ErrSource, *Subscription, error) {
+	candidates := hedgeCandidates(vAddr, n)
+	delay := hedgeDelay(tags)
+	dedupe := tags[TagDedupeHeader] != ""
+
+	attempts := make([]func(context.Context) (<-chan Source, error), len(candidates))
+	for i, addr := range candidates {
+		i, addr := i, addr
+		attempts[i] = func(attemptCtx context.Context) (<-chan Source, error) {
+			sources, err := c.dialAndSubscribe(attemptCtx, addr, body, withBucket(tags, i))
+			if err != nil {
+				return nil, err
+			}
+			// mergeSources picks whichever attempt() returns first as the
+			// winner, so this must not return until the backend actually has
+			// something to say: otherwise it would win on accepting the
+			// connection rather than on having data, making hedging pick an
+			// arbitrary backend instead of the fastest one.
+			return hedgeAttemptSources(attemptCtx, sources)
+		}
+	}
+
+	merged, sub := mergeSources(ctx, attempts, delay, dedupe)
+	return toErrSourceChan(merged), sub, nil
+}
+
+// hedgeAttemptSources blocks until sources yields its first ErrSource (or
+// closes, or attemptCtx is cancelled), then returns a channel that replays it
+// followed by the rest of sources. Blocking for the first item, rather than
+// returning as soon as dialAndSubscribe hands back a channel, turns "attempt
+// returned" into "attempt found data", which is what mergeSources uses to
+// pick a hedge winner.
+//
+// Every handoff onto the returned channel also selects on attemptCtx.Done():
+// once mergeSources decides this attempt lost the race, it cancels
+// attemptCtx and stops reading from the returned channel, and a plain
+// unconditional send would then block the forwarding goroutine forever on an
+// abandoned attempt that is still producing Sources.
+func hedgeAttemptSources(attemptCtx context.Context, sources <-chan ErrSource) (<-chan Source, error) {
+	select {
+	case first, ok := <-sources:
+		if !ok {
+			return nil, errors.New("chanserv: hedge attempt produced no Source")
+		}
+		out := make(chan Source, 1)
+		out <- first
+		go func() {
+			defer close(out)
+			for {
+				select {
+				case s, ok := <-sources:
+					if !ok {
+						return
+					}
+					select {
+					case out <- s:
+					case <-attemptCtx.Done():
+						return
+					}
+				case <-attemptCtx.Done():
+					return
+				}
+			}
+		}()
+		return out, nil
+	case <-attemptCtx.Done():
+		return nil, attemptCtx.Err()
+	}
+}
+
+// withBucket returns a copy of tags with TagBucket set to i. Tags only travel
+// to the server inside the subscription request; Multiplexer.DialTimeout
+// never sees them, so TagBucket has no effect on which backend is dialled.
+func withBucket(tags map[RequestTag]string, i int) map[RequestTag]string {
+	out := cloneTags(tags)
+	out[TagBucket] = strconv.Itoa(i)
+	return out
+}
+
+// hedgeCount parses TagHedge, defaulting to 1 (no hedging) if it is unset or
+// not a valid positive integer.
+func hedgeCount(tags map[RequestTag]string) int {
+	n, err := strconv.Atoi(tags[TagHedge])
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// hedgeDelay parses TagHedgeDelay, defaulting to no stagger (attempts fire
+// together) if it is unset or not a valid duration.
+func hedgeDelay(tags map[RequestTag]string) time.Duration {
+	d, err := time.ParseDuration(tags[TagHedgeDelay])
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// hedgeCandidates splits vAddr on commas into n candidate addresses, cycling
+// through the given list if it has fewer than n entries.
+func hedgeCandidates(vAddr string, n int) []string {
+	parts := strings.Split(vAddr, ",")
+	out := make([]string, n)
+	for i := range out {
+		out[i] = strings.TrimSpace(parts[i%len(parts)])
+	}
+	return out
+}
+
+// cloneTags returns a shallow copy of tags so per-attempt mutations (setting
+// TagBucket) don't race with other hedged attempts sharing the same map.
+func cloneTags(tags map[RequestTag]string) map[RequestTag]string {
+	out := make(map[RequestTag]string, len(tags)+1)
+	for k, v := range tags {
+		out[k] = v
+	}
+	return out
+}
+
+// toErrSourceChan adapts mergeSources' <-chan Source back to <-chan ErrSource:
+// every Source dialAndSubscribe hands to mergeSources is already a
+// *clientSource (an ErrSource), so this is just a type assertion per value.
+func toErrSourceChan(in <-chan Source) <-chan ErrSource {
+	out := make(chan ErrSource)
+	go func() {
+		defer close(out)
+		for s := range in {
+			if es, ok := s.(ErrSource); ok {
+				out <- es
+			}
+		}
+	}()
+	return out
+}
+
+func (c *netClient) LookupService(ctx context.Context, name string) (<-chan Endpoint, error) {
+	if c.opts.discovery == nil {
+		return nil, errors.New("chanserv: no Discovery configured; use WithDiscovery")
+	}
+	return c.opts.discovery.Resolve(ctx, name)
+}
+
+func (c *netClient) dialAndSubscribe(ctx context.Context, vAddr string, body []byte, tags map[RequestTag]string) (<-chan ErrSource, error) {
+	conn, err := c.mux.DialTimeout(defaultNetwork, vAddr, defaultDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	enc := gob.NewEncoder(conn)
+	dec := gob.NewDecoder(conn)
+
+	if err := enc.Encode(subscribeRequest{Body: body, Tags: tags}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var resp subscribeResponseHeader
+	if err := dec.Decode(&resp); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	chosen, ok := availableCodecs(c.opts.codecs)[resp.Codec]
+	if !ok {
+		chosen = availableCodecs(c.opts.codecs)["identity"]
+	}
+
+	out := make(chan ErrSource)
+	go c.readLoop(ctx, conn, dec, chosen, out, vAddr)
+	return out, nil
+}
+
+// readLoop decodes the wireMsg stream for a single subscription, delivering
+// ErrSources (and their Frames) on out until the stream ends, the server
+// reports an error, or ctx is cancelled.
+func (c *netClient) readLoop(ctx context.Context, conn net.Conn, dec *gob.Decoder, chosen codec, out chan<- ErrSource, vAddr string) {
+	defer close(out)
+	defer conn.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	var current *clientSource
+	for {
+		var msg wireMsg
+		if err := dec.Decode(&msg); err != nil {
+			if current != nil {
+				current.finish(readErr(ctx, err))
+			}
+			return
+		}
+
+		switch msg.Kind {
+		case msgSourceStart:
+			current = newClientSource(msg.Bytes, vAddr)
+			select {
+			case out <- current:
+			case <-ctx.Done():
+				return
+			}
+		case msgFrameData:
+			if current == nil {
+				continue
+			}
+			payload, err := chosen.dec.Decode(msg.Bytes)
+			if err != nil {
+				current.finish(err)
+				return
+			}
+			select {
+			case current.out <- byteFrame(payload):
+			case <-ctx.Done():
+				current.finish(ctx.Err())
+				return
+			}
+		case msgSourceEnd:
+			if current != nil {
+				current.finish(nil)
+				current = nil
+			}
+		case msgStreamErr:
+			if current != nil {
+				current.finish(errors.New(msg.ErrMsg))
+				current = nil
+			}
+			return
+		case msgStreamEnd:
+			return
+		}
+	}
+}
+
+// readErr prefers reporting ctx's cancellation reason over a raw decode
+// error, since a cancelled ctx is what forced conn closed in the first place.
+func readErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// errSourceChan adapts a <-chan ErrSource to a <-chan Source for
+// LookupAndPost, which predates ErrSource. The concrete values are still
+// ErrSource underneath, so callers can still type-assert to reach Err().
+func errSourceChan(in <-chan ErrSource) <-chan Source {
+	out := make(chan Source)
+	go func() {
+		defer close(out)
+		for s := range in {
+			out <- s
+		}
+	}()
+	return out
+}
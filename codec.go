@@ -0,0 +1,113 @@
+package chanserv
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+)
+
+// FrameEncoder compresses (or otherwise transforms) a Frame's bytes before
+// they are written to the wire.
+type FrameEncoder interface {
+	Encode(p []byte) ([]byte, error)
+}
+
+// FrameDecoder reverses the transform applied by the matching FrameEncoder.
+type FrameDecoder interface {
+	Decode(p []byte) ([]byte, error)
+}
+
+// WithFrameCodec returns a ServerOption carrying a named codec for a Server or
+// Client implementation to offer during its own subscription handshake,
+// selectable via a client's TagCodecPreference tag. This package supplies the
+// option, the identity/gzip codecs, and negotiateCodec's selection logic;
+// performing the actual handshake over the wire is that implementation's
+// responsibility.
+func WithFrameCodec(name string, enc FrameEncoder, dec FrameDecoder) ServerOption {
+	return func(o *serverOptions) {
+		if o.codecs == nil {
+			o.codecs = make(map[string]codec)
+		}
+		o.codecs[name] = codec{enc: enc, dec: dec}
+	}
+}
+
+type codec struct {
+	enc FrameEncoder
+	dec FrameDecoder
+}
+
+// identityCodec is the default, always-available codec: it returns its
+// input unchanged. It is the fallback when negotiation finds no common
+// codec between client and server.
+type identityCodec struct{}
+
+func (identityCodec) Encode(p []byte) ([]byte, error) { return p, nil }
+func (identityCodec) Decode(p []byte) ([]byte, error) { return p, nil }
+
+// gzipCodec implements FrameEncoder/FrameDecoder on top of compress/gzip. It
+// is registered under the name "gzip" by default so it's available without
+// requiring an external dependency. There is no built-in "snappy" or "zstd"
+// codec: a name listed in TagCodecPreference is only negotiated once a
+// FrameEncoder/FrameDecoder pair has been registered under it via
+// WithFrameCodec.
+type gzipCodec struct{}
+
+func (gzipCodec) Encode(p []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(p); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decode(p []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(p))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func defaultCodecs() map[string]codec {
+	return map[string]codec{
+		"identity": {enc: identityCodec{}, dec: identityCodec{}},
+		"gzip":     {enc: gzipCodec{}, dec: gzipCodec{}},
+	}
+}
+
+// negotiateCodec picks the first name in preference (most preferred first)
+// present in both preference and available, falling back to "identity".
+func negotiateCodec(preference []string, available map[string]codec) (string, codec) {
+	for _, name := range preference {
+		if c, ok := available[name]; ok {
+			return name, c
+		}
+	}
+	return "identity", available["identity"]
+}
+
+// availableCodecs merges defaultCodecs() with whatever was registered via
+// WithFrameCodec, the latter taking precedence on a name collision.
+func availableCodecs(custom map[string]codec) map[string]codec {
+	out := defaultCodecs()
+	for name, c := range custom {
+		out[name] = c
+	}
+	return out
+}
+
+// parseCodecPreference splits a TagCodecPreference value ("zstd,gzip") into
+// its ordered list of names, returning nil for an empty/unset tag.
+func parseCodecPreference(tag string) []string {
+	if tag == "" {
+		return nil
+	}
+	return strings.Split(tag, ",")
+}
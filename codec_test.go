@@ -0,0 +1,71 @@
+package chanserv
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestIdentityCodecRoundTrip(t *testing.T) {
+	var c identityCodec
+	in := []byte("passthrough")
+
+	enc, err := c.Encode(in)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	dec, err := c.Decode(enc)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !bytes.Equal(dec, in) {
+		t.Fatalf("got %q, want %q", dec, in)
+	}
+}
+
+func TestGzipCodecRoundTrip(t *testing.T) {
+	var c gzipCodec
+	in := bytes.Repeat([]byte("hello chanserv "), 64)
+
+	enc, err := c.Encode(in)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if bytes.Equal(enc, in) {
+		t.Fatalf("expected encoded output to differ from input")
+	}
+
+	dec, err := c.Decode(enc)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !bytes.Equal(dec, in) {
+		t.Fatalf("round-trip mismatch: got %d bytes, want %d bytes", len(dec), len(in))
+	}
+}
+
+func TestNegotiateCodecPrefersEarliestAvailable(t *testing.T) {
+	available := defaultCodecs()
+	name, c := negotiateCodec([]string{"zstd", "gzip", "identity"}, available)
+	if name != "gzip" {
+		t.Fatalf("negotiated %q, want %q", name, "gzip")
+	}
+	if c.enc == nil || c.dec == nil {
+		t.Fatal("expected a non-empty codec pair for gzip")
+	}
+}
+
+func TestNegotiateCodecFallsBackToIdentity(t *testing.T) {
+	available := defaultCodecs()
+	name, _ := negotiateCodec([]string{"zstd", "snappy"}, available)
+	if name != "identity" {
+		t.Fatalf("negotiated %q, want %q", name, "identity")
+	}
+}
+
+func TestNegotiateCodecNoPreferenceFallsBackToIdentity(t *testing.T) {
+	available := defaultCodecs()
+	name, _ := negotiateCodec(nil, available)
+	if name != "identity" {
+		t.Fatalf("negotiated %q, want %q", name, "identity")
+	}
+}
@@ -0,0 +1,41 @@
+package chanserv
+
+import "context"
+
+// Endpoint is a resolved service announcement: a vAddr on the Multiplexer
+// together with whatever metadata the registering Server attached to it.
+type Endpoint struct {
+	VAddr string
+	Meta  map[string]string
+}
+
+// Discovery is a transport-agnostic service discovery backend. Implementations
+// are free to back this with mDNS, Consul, etcd, a static file, or anything
+// else; Server and Client only depend on this interface.
+type Discovery interface {
+	// Register announces vAddr under the given service name, along with
+	// optional metadata, until Deregister is called or the Discovery is closed.
+	Register(service, vAddr string, meta map[string]string) error
+	// Deregister withdraws a previously registered announcement.
+	Deregister(service, vAddr string) error
+	// Resolve watches for endpoints offering service and streams them on the
+	// returned channel as they are discovered. The channel is closed when ctx
+	// is cancelled.
+	Resolve(ctx context.Context, service string) (<-chan Endpoint, error)
+	// Close releases any background goroutines and connections the Discovery
+	// backend holds. It does not withdraw registrations made with Register;
+	// callers that need that should Deregister first.
+	Close() error
+}
+
+// WithDiscovery returns a ServerOption carrying d and serviceName for a Server
+// implementation to use: publishing vAddr under serviceName when its listener
+// comes up, and withdrawing the announcement (Deregister) on shutdown. This
+// package provides the option and the Discovery backends; wiring it into an
+// accept loop is the Server implementation's responsibility.
+func WithDiscovery(d Discovery, serviceName string) ServerOption {
+	return func(o *serverOptions) {
+		o.discovery = d
+		o.discoveryService = serviceName
+	}
+}
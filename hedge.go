@@ -0,0 +1,155 @@
+package chanserv
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+const (
+	// TagHedge holds the number of attempts LookupAndPost should dispatch the
+	// same request to. To actually land on distinct backends, vAddr must be a
+	// comma-separated list of candidate addresses (cycled through if shorter
+	// than the hedge count); a single vAddr just dials that one address n
+	// times. Each attempt also carries its index via TagBucket, but only in
+	// the subscription request sent to the server: Multiplexer.DialTimeout
+	// never receives request tags, so the index has no effect on which
+	// backend an attempt is dialled to. The attempts are staggered by
+	// TagHedgeDelay; the first one to yield a Source wins and the rest are
+	// cancelled.
+	TagHedge RequestTag = iota + tagHedgeBase
+	// TagHedgeDelay holds the stagger between successive hedged attempts, as a
+	// duration string parseable by time.ParseDuration (e.g. "20ms").
+	TagHedgeDelay
+	// TagDedupeHeader, if set to a non-empty value, tells the client to drop
+	// Source announcements whose Header() hashes the same as one already
+	// yielded by a winning hedged attempt.
+	TagDedupeHeader
+)
+
+// tagHedgeBase reserves room after TagCodecPreference so hedge-related tags
+// never collide with other RequestTag additions.
+const tagHedgeBase = 200
+
+// Subscription is returned alongside a hedged LookupAndPost's Source channel
+// so callers can inspect what happened to the attempts that didn't win.
+type Subscription struct {
+	// Winner is the index of the attempt whose Source is being delivered on
+	// the channel: for a hedged LookupAndPost, the candidate's position in
+	// vAddr's comma-separated list (after cycling), which is also the
+	// TagBucket value that attempt was sent with.
+	Winner int
+	// Errs holds one entry per losing attempt, in the order its cancellation
+	// or failure was observed. A losing attempt that was simply cancelled
+	// because another attempt already won reports context.Canceled.
+	Errs []error
+}
+
+// mergeSources forwards every Source of the winning attempt (the first of
+// attempts to return without error) onto a single channel, cancelling every
+// other in-flight attempt once the winner is selected. Attempt i (i > 0) is dispatched only after waiting i*delay,
+// so a winner found early cancels not-yet-started attempts before they ever
+// call out to a backend. Each attempt function is called with a child of
+// ctx that the caller should tie to their own dial/subscribe work;
+// mergeSources cancels it on behalf of the loser automatically. If
+// dedupeHeader is true, Sources from the winning attempt whose Header()
+// hashes the same as one already yielded are silently dropped.
+func mergeSources(ctx context.Context, attempts []func(context.Context) (<-chan Source, error), delay time.Duration, dedupeHeader bool) (<-chan Source, *Subscription) {
+	out := make(chan Source)
+	sub := &Subscription{Winner: -1}
+
+	var mu sync.Mutex
+	var once sync.Once
+
+	// Every attemptCtx/cancel pair is created up front, before any goroutine
+	// is started, so the winner's cancel-the-losers loop never races with the
+	// construction of cancels.
+	attemptCtxs := make([]context.Context, len(attempts))
+	cancels := make([]context.CancelFunc, len(attempts))
+	for i := range attempts {
+		attemptCtxs[i], cancels[i] = context.WithCancel(ctx)
+	}
+
+	var seenMu sync.Mutex
+	seen := make(map[[sha256.Size]byte]struct{})
+
+	var wg sync.WaitGroup
+	for i, attempt := range attempts {
+		i, attempt := i, attempt
+		attemptCtx := attemptCtxs[i]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if i > 0 && delay > 0 {
+				timer := time.NewTimer(time.Duration(i) * delay)
+				defer timer.Stop()
+				select {
+				case <-timer.C:
+				case <-attemptCtx.Done():
+					mu.Lock()
+					sub.Errs = append(sub.Errs, attemptCtx.Err())
+					mu.Unlock()
+					return
+				}
+			}
+
+			src, err := attempt(attemptCtx)
+			if err != nil {
+				mu.Lock()
+				sub.Errs = append(sub.Errs, err)
+				mu.Unlock()
+				return
+			}
+
+			var won bool
+			once.Do(func() {
+				won = true
+				mu.Lock()
+				sub.Winner = i
+				mu.Unlock()
+				for j, c := range cancels {
+					if j != i && c != nil {
+						c()
+					}
+				}
+			})
+			if !won {
+				cancels[i]()
+				mu.Lock()
+				sub.Errs = append(sub.Errs, attemptCtx.Err())
+				mu.Unlock()
+				return
+			}
+
+			for s := range src {
+				if dedupeHeader {
+					h := sha256.Sum256(s.Header())
+					seenMu.Lock()
+					_, dup := seen[h]
+					if !dup {
+						seen[h] = struct{}{}
+					}
+					seenMu.Unlock()
+					if dup {
+						continue
+					}
+				}
+				select {
+				case out <- s:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out, sub
+}
@@ -0,0 +1,147 @@
+package chanserv
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSource struct {
+	header []byte
+	out    chan Frame
+}
+
+func (s *fakeSource) Header() []byte    { return s.header }
+func (s *fakeSource) Meta() MetaData    { return nil }
+func (s *fakeSource) Out() <-chan Frame { return s.out }
+
+func closedSourceChan(srcs ...*fakeSource) <-chan Source {
+	ch := make(chan Source, len(srcs))
+	for _, s := range srcs {
+		ch <- s
+	}
+	close(ch)
+	return ch
+}
+
+func TestMergeSourcesPicksFirstSuccessAndCancelsLosers(t *testing.T) {
+	cancelled := make(chan int, 1)
+
+	attempts := []func(context.Context) (<-chan Source, error){
+		func(ctx context.Context) (<-chan Source, error) {
+			return closedSourceChan(&fakeSource{header: []byte("a")}), nil
+		},
+		func(ctx context.Context) (<-chan Source, error) {
+			<-ctx.Done()
+			cancelled <- 1
+			return nil, ctx.Err()
+		},
+	}
+
+	out, sub := mergeSources(context.Background(), attempts, 0, false)
+
+	var got []Source
+	for s := range out {
+		got = append(got, s)
+	}
+
+	if len(got) != 1 || string(got[0].Header()) != "a" {
+		t.Fatalf("unexpected sources delivered: %+v", got)
+	}
+	if sub.Winner != 0 {
+		t.Fatalf("Winner = %d, want 0", sub.Winner)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("losing attempt was never cancelled")
+	}
+	if len(sub.Errs) != 1 {
+		t.Fatalf("expected 1 recorded loser error, got %d", len(sub.Errs))
+	}
+}
+
+func TestMergeSourcesStaggersAttemptDispatch(t *testing.T) {
+	var mu sync.Mutex
+	var started []time.Time
+
+	attempts := make([]func(context.Context) (<-chan Source, error), 3)
+	for i := range attempts {
+		attempts[i] = func(ctx context.Context) (<-chan Source, error) {
+			mu.Lock()
+			started = append(started, time.Now())
+			mu.Unlock()
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+	}
+
+	delay := 30 * time.Millisecond
+	outerCtx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	out, _ := mergeSources(outerCtx, attempts, delay, false)
+	for range out {
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(started) != 3 {
+		t.Fatalf("expected all 3 attempts to eventually start, got %d", len(started))
+	}
+	for i := 1; i < len(started); i++ {
+		gap := started[i].Sub(started[i-1])
+		if gap < delay/2 {
+			t.Fatalf("attempt %d started only %v after attempt %d, want roughly >= %v", i, gap, i-1, delay)
+		}
+	}
+}
+
+func TestMergeSourcesDedupesByHeaderHash(t *testing.T) {
+	attempts := []func(context.Context) (<-chan Source, error){
+		func(ctx context.Context) (<-chan Source, error) {
+			return closedSourceChan(
+				&fakeSource{header: []byte("dup")},
+				&fakeSource{header: []byte("dup")},
+				&fakeSource{header: []byte("unique")},
+			), nil
+		},
+	}
+
+	out, _ := mergeSources(context.Background(), attempts, 0, true)
+
+	var got []Source
+	for s := range out {
+		got = append(got, s)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected duplicate header to be dropped, got %d sources", len(got))
+	}
+	if string(got[0].Header()) != "dup" || string(got[1].Header()) != "unique" {
+		t.Fatalf("unexpected headers delivered: %q, %q", got[0].Header(), got[1].Header())
+	}
+}
+
+func TestMergeSourcesWithoutDedupeKeepsDuplicates(t *testing.T) {
+	attempts := []func(context.Context) (<-chan Source, error){
+		func(ctx context.Context) (<-chan Source, error) {
+			return closedSourceChan(
+				&fakeSource{header: []byte("dup")},
+				&fakeSource{header: []byte("dup")},
+			), nil
+		},
+	}
+
+	out, _ := mergeSources(context.Background(), attempts, 0, false)
+
+	var count int
+	for range out {
+		count++
+	}
+	if count != 2 {
+		t.Fatalf("expected duplicates to pass through when dedupe is off, got %d", count)
+	}
+}
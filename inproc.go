@@ -0,0 +1,251 @@
+package chanserv
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// NewInprocMux returns a Multiplexer implemented purely with Go channels: no
+// sockets and no AstraNet. It lets a Server and a Client be wired together
+// inside a single process, which is useful for unit tests and for embedding
+// chanserv into pipelines that don't need an actual network hop. Every
+// inprocMux returned by NewInprocMux has its own listener registry, so
+// separate instances never see each other's vAddrs.
+func NewInprocMux() Multiplexer {
+	return &inprocMux{listeners: make(map[string]*inprocListener)}
+}
+
+type inprocMux struct {
+	mu        sync.Mutex
+	listeners map[string]*inprocListener
+}
+
+// Bind registers laddr in the mux's in-memory registry and returns a
+// net.Listener whose Accept reads connections dialled via DialTimeout.
+func (m *inprocMux) Bind(network, laddr string) (net.Listener, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.listeners[laddr]; ok {
+		return nil, errors.New("chanserv: inproc address already in use: " + laddr)
+	}
+	l := &inprocListener{
+		mux:    m,
+		addr:   inprocAddr{network: network, addr: laddr},
+		accept: make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+	m.listeners[laddr] = l
+	return l, nil
+}
+
+// DialTimeout looks up address in the mux's registry and hands the matching
+// listener one end of a paired net.Conn, returning the other end. It fails
+// with a timeout error if no Accept call claims the connection within timeout.
+func (m *inprocMux) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	m.mu.Lock()
+	l, ok := m.listeners[address]
+	m.mu.Unlock()
+	if !ok {
+		return nil, &net.OpError{Op: "dial", Net: network, Addr: inprocAddr{network: network, addr: address}, Err: errors.New("chanserv: no inproc listener bound")}
+	}
+
+	client, server := newInprocConnPair(inprocAddr{network: network, addr: address})
+
+	var after <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		after = timer.C
+	}
+
+	select {
+	case l.accept <- server:
+		return client, nil
+	case <-l.closed:
+		return nil, &net.OpError{Op: "dial", Net: network, Addr: inprocAddr{network: network, addr: address}, Err: errors.New("chanserv: inproc listener closed")}
+	case <-after:
+		return nil, &net.OpError{Op: "dial", Net: network, Addr: inprocAddr{network: network, addr: address}, Err: errTimeout}
+	}
+}
+
+type inprocAddr struct {
+	network string
+	addr    string
+}
+
+func (a inprocAddr) Network() string { return a.network }
+func (a inprocAddr) String() string  { return a.addr }
+
+type inprocListener struct {
+	mux    *inprocMux
+	addr   inprocAddr
+	accept chan net.Conn
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (l *inprocListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.accept:
+		return c, nil
+	case <-l.closed:
+		return nil, errors.New("chanserv: inproc listener closed")
+	}
+}
+
+func (l *inprocListener) Close() error {
+	l.closeOnce.Do(func() {
+		l.mux.mu.Lock()
+		delete(l.mux.listeners, l.addr.addr)
+		l.mux.mu.Unlock()
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *inprocListener) Addr() net.Addr { return l.addr }
+
+// inprocConnState is shared by both ends of an inproc connection pair so
+// that whichever side closes first tears down both: Close on either end must
+// close the same "closed" channel exactly once.
+type inprocConnState struct {
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// inprocConn is a net.Conn backed by two byte channels, satisfying deadline
+// semantics via a timer per pending read/write.
+type inprocConn struct {
+	local, remote inprocAddr
+	in            <-chan []byte
+	out           chan<- []byte
+	state         *inprocConnState
+
+	mu                          sync.Mutex
+	readDeadline, writeDeadline time.Time
+	readBuf                     []byte
+}
+
+func newInprocConnPair(addr inprocAddr) (client, server *inprocConn) {
+	ab := make(chan []byte, 16)
+	ba := make(chan []byte, 16)
+	state := &inprocConnState{closed: make(chan struct{})}
+	client = &inprocConn{local: inprocAddr{network: addr.network, addr: "inproc-client"}, remote: addr, in: ba, out: ab, state: state}
+	server = &inprocConn{local: addr, remote: client.local, in: ab, out: ba, state: state}
+	return client, server
+}
+
+func (c *inprocConn) Read(b []byte) (int, error) {
+	if len(c.readBuf) == 0 {
+		// A non-blocking check of c.in first means data the peer already wrote
+		// (and is sitting in the channel buffer) is delivered even if the peer
+		// has since called Close: otherwise the blocking select below could
+		// pick the now-ready c.state.closed case instead, losing buffered data
+		// the peer considers already sent.
+		select {
+		case chunk, ok := <-c.in:
+			if !ok {
+				return 0, errClosedConn
+			}
+			c.readBuf = chunk
+		default:
+			var timeout <-chan time.Time
+			if d := c.getReadDeadline(); !d.IsZero() {
+				timer := time.NewTimer(time.Until(d))
+				defer timer.Stop()
+				timeout = timer.C
+			}
+			select {
+			case chunk, ok := <-c.in:
+				if !ok {
+					return 0, errClosedConn
+				}
+				c.readBuf = chunk
+			case <-c.state.closed:
+				return 0, errClosedConn
+			case <-timeout:
+				return 0, errTimeout
+			}
+		}
+	}
+	n := copy(b, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+func (c *inprocConn) Write(b []byte) (int, error) {
+	cp := make([]byte, len(b))
+	copy(cp, b)
+
+	var timeout <-chan time.Time
+	if d := c.getWriteDeadline(); !d.IsZero() {
+		timer := time.NewTimer(time.Until(d))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case c.out <- cp:
+		return len(b), nil
+	case <-c.state.closed:
+		return 0, errClosedConn
+	case <-timeout:
+		return 0, errTimeout
+	}
+}
+
+func (c *inprocConn) Close() error {
+	c.state.closeOnce.Do(func() { close(c.state.closed) })
+	return nil
+}
+
+func (c *inprocConn) LocalAddr() net.Addr  { return c.local }
+func (c *inprocConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *inprocConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	c.SetWriteDeadline(t)
+	return nil
+}
+
+func (c *inprocConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *inprocConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *inprocConn) getReadDeadline() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readDeadline
+}
+
+func (c *inprocConn) getWriteDeadline() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.writeDeadline
+}
+
+var errClosedConn = errors.New("chanserv: use of closed inproc connection")
+
+// timeoutError implements net.Error so callers using the standard
+// "is this Temporary/Timeout" checks (e.g. handleAcceptErr) work unchanged
+// against an inproc connection.
+type timeoutError struct{ msg string }
+
+func (e *timeoutError) Error() string   { return e.msg }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+var errTimeout = &timeoutError{msg: "chanserv: i/o timeout"}
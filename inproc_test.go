@@ -0,0 +1,125 @@
+package chanserv
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestInprocMuxBindDialRoundTrip(t *testing.T) {
+	mux := NewInprocMux()
+
+	l, err := mux.Bind("inproc", "vaddr:1")
+	if err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	defer l.Close()
+
+	acceptErr := make(chan error, 1)
+	var server io.ReadWriteCloser
+	go func() {
+		conn, err := l.Accept()
+		server = conn
+		acceptErr <- err
+	}()
+
+	client, err := mux.DialTimeout("inproc", "vaddr:1", time.Second)
+	if err != nil {
+		t.Fatalf("DialTimeout: %v", err)
+	}
+	defer client.Close()
+
+	if err := <-acceptErr; err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	defer server.Close()
+
+	want := []byte("hello over channels")
+	if _, err := client.Write(want); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(server, got); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestInprocMuxDialTimeoutWithoutListener(t *testing.T) {
+	mux := NewInprocMux()
+	if _, err := mux.DialTimeout("inproc", "nobody-home", 10*time.Millisecond); err == nil {
+		t.Fatal("expected error dialling an unbound address")
+	}
+}
+
+func TestInprocMuxDialTimeoutWithoutAccept(t *testing.T) {
+	mux := NewInprocMux()
+	l, err := mux.Bind("inproc", "vaddr:2")
+	if err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	defer l.Close()
+
+	start := time.Now()
+	_, err = mux.DialTimeout("inproc", "vaddr:2", 20*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected dial timeout error when nothing calls Accept")
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("dial returned after %v, expected to wait out the timeout", elapsed)
+	}
+}
+
+func TestInprocConnReadDeadline(t *testing.T) {
+	mux := NewInprocMux()
+	l, err := mux.Bind("inproc", "vaddr:3")
+	if err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	defer l.Close()
+
+	go mux.DialTimeout("inproc", "vaddr:3", time.Second)
+
+	server, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	defer server.Close()
+
+	server.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	buf := make([]byte, 1)
+	if _, err := server.Read(buf); err == nil {
+		t.Fatal("expected read deadline to expire with no data written")
+	}
+}
+
+func TestInprocListenerCloseUnblocksAccept(t *testing.T) {
+	mux := NewInprocMux()
+	l, err := mux.Bind("inproc", "vaddr:4")
+	if err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := l.Accept()
+		done <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected Accept to return an error after Close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Accept did not unblock after listener Close")
+	}
+}
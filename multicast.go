@@ -0,0 +1,210 @@
+package chanserv
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// multicastGroup is the multicast group and port chanserv's own discovery
+// protocol announces on. It is not the standard mDNS port 5353 and does not
+// speak DNS-SD: this is a private wire format (see encodeAnnouncement) for
+// chanserv participants only, not interoperable with Bonjour/avahi/mDNS
+// resolvers.
+var multicastGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5454}
+
+const multicastAnnounceInterval = 5 * time.Second
+
+// NewMulticastDiscovery returns a Discovery backend that announces registrations
+// over IPv4 multicast on the LAN and resolves services by listening for those
+// announcements, using chanserv's own line-oriented wire format rather than
+// DNS-SD/mDNS. It requires no external registry: every participant both
+// speaks and listens on multicastGroup.
+func NewMulticastDiscovery() (Discovery, error) {
+	conn, err := net.ListenMulticastUDP("udp4", nil, multicastGroup)
+	if err != nil {
+		return nil, fmt.Errorf("chanserv: multicast listen: %w", err)
+	}
+	d := &multicastDiscovery{
+		conn:        conn,
+		stop:        make(chan struct{}),
+		regs:        make(map[string]multicastReg),
+		subscribers: make(map[string][]chan Endpoint),
+	}
+	go d.readLoop()
+	go d.announceLoop()
+	return d, nil
+}
+
+type multicastReg struct {
+	vAddr string
+	meta  map[string]string
+}
+
+type multicastDiscovery struct {
+	conn *net.UDPConn
+	stop chan struct{}
+
+	mu          sync.Mutex
+	regs        map[string]multicastReg
+	subscribers map[string][]chan Endpoint
+	closed      bool
+}
+
+func (d *multicastDiscovery) Register(service, vAddr string, meta map[string]string) error {
+	d.mu.Lock()
+	d.regs[regKey(service, vAddr)] = multicastReg{vAddr: vAddr, meta: meta}
+	d.mu.Unlock()
+	return d.send(service, vAddr, meta)
+}
+
+func (d *multicastDiscovery) Deregister(service, vAddr string) error {
+	d.mu.Lock()
+	delete(d.regs, regKey(service, vAddr))
+	d.mu.Unlock()
+	return nil
+}
+
+// Close stops the announce and read loops and closes the underlying
+// multicast socket. It is safe to call more than once.
+func (d *multicastDiscovery) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	d.mu.Unlock()
+	close(d.stop)
+	return d.conn.Close()
+}
+
+func (d *multicastDiscovery) Resolve(ctx context.Context, service string) (<-chan Endpoint, error) {
+	ch := make(chan Endpoint, 8)
+
+	d.mu.Lock()
+	d.subscribers[service] = append(d.subscribers[service], ch)
+	d.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		// close(ch) happens under d.mu, same as readLoop's send below, so the
+		// two can never race: either readLoop's send/unsubscribe-check runs
+		// first (ch is still open and still in subscribers), or this runs
+		// first (ch is gone from subscribers before readLoop can see it, so
+		// it is never sent to after being closed).
+		d.mu.Lock()
+		subs := d.subscribers[service]
+		for i, c := range subs {
+			if c == ch {
+				d.subscribers[service] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+		close(ch)
+		d.mu.Unlock()
+	}()
+
+	return ch, nil
+}
+
+func (d *multicastDiscovery) announceLoop() {
+	t := time.NewTicker(multicastAnnounceInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-t.C:
+		}
+
+		d.mu.Lock()
+		regs := make([]struct {
+			service string
+			multicastReg
+		}, 0, len(d.regs))
+		for key, reg := range d.regs {
+			service := strings.SplitN(key, "\x00", 2)[0]
+			regs = append(regs, struct {
+				service string
+				multicastReg
+			}{service, reg})
+		}
+		d.mu.Unlock()
+
+		for _, r := range regs {
+			_ = d.send(r.service, r.vAddr, r.meta)
+		}
+	}
+}
+
+func (d *multicastDiscovery) readLoop() {
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := d.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		service, ep, ok := decodeAnnouncement(buf[:n])
+		if !ok {
+			continue
+		}
+		d.deliver(service, ep)
+	}
+}
+
+// deliver fans ep out to every subscriber of service, dropping it for any
+// subscriber whose buffer is full. Sending under d.mu, rather than on a
+// snapshot taken after unlocking, is what keeps this from racing with
+// Resolve's unsubscribe goroutine closing a subscriber's channel: both the
+// send and the close happen while holding the same lock, so a channel can
+// never be sent to after (or while) it is closed.
+func (d *multicastDiscovery) deliver(service string, ep Endpoint) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, ch := range d.subscribers[service] {
+		select {
+		case ch <- ep:
+		default:
+		}
+	}
+}
+
+func (d *multicastDiscovery) send(service, vAddr string, meta map[string]string) error {
+	_, err := d.conn.WriteToUDP(encodeAnnouncement(service, vAddr, meta), multicastGroup)
+	return err
+}
+
+func regKey(service, vAddr string) string { return service + "\x00" + vAddr }
+
+// encodeAnnouncement/decodeAnnouncement use a tiny line-oriented wire format:
+// "service\x00vAddr\x00k1=v1,k2=v2". It is intentionally simple since the
+// payload never leaves the LAN and carries no sensitive data.
+func encodeAnnouncement(service, vAddr string, meta map[string]string) []byte {
+	pairs := make([]string, 0, len(meta))
+	for k, v := range meta {
+		pairs = append(pairs, k+"="+v)
+	}
+	msg := service + "\x00" + vAddr + "\x00" + strings.Join(pairs, ",")
+	return []byte(msg)
+}
+
+func decodeAnnouncement(b []byte) (service string, ep Endpoint, ok bool) {
+	parts := strings.SplitN(string(b), "\x00", 3)
+	if len(parts) != 3 {
+		return "", Endpoint{}, false
+	}
+	meta := map[string]string{}
+	if parts[2] != "" {
+		for _, pair := range strings.Split(parts[2], ",") {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) == 2 {
+				meta[kv[0]] = kv[1]
+			}
+		}
+	}
+	return parts[0], Endpoint{VAddr: parts[1], Meta: meta}, true
+}
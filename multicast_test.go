@@ -0,0 +1,108 @@
+package chanserv
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestEncodeDecodeAnnouncementRoundTrip(t *testing.T) {
+	service := "chanserv.test"
+	vAddr := "VHyWCWr39kI:1697777"
+	meta := map[string]string{"region": "us-east", "weight": "10"}
+
+	wire := encodeAnnouncement(service, vAddr, meta)
+	gotService, ep, ok := decodeAnnouncement(wire)
+	if !ok {
+		t.Fatalf("decodeAnnouncement failed on well-formed input")
+	}
+	if gotService != service {
+		t.Fatalf("service = %q, want %q", gotService, service)
+	}
+	if ep.VAddr != vAddr {
+		t.Fatalf("vAddr = %q, want %q", ep.VAddr, vAddr)
+	}
+	for k, v := range meta {
+		if ep.Meta[k] != v {
+			t.Fatalf("meta[%q] = %q, want %q", k, ep.Meta[k], v)
+		}
+	}
+}
+
+func TestEncodeDecodeAnnouncementEmptyMeta(t *testing.T) {
+	wire := encodeAnnouncement("svc", "vaddr:1", nil)
+	service, ep, ok := decodeAnnouncement(wire)
+	if !ok {
+		t.Fatalf("decodeAnnouncement failed on empty meta")
+	}
+	if service != "svc" || ep.VAddr != "vaddr:1" || len(ep.Meta) != 0 {
+		t.Fatalf("unexpected decode result: %q %+v", service, ep)
+	}
+}
+
+func TestDecodeAnnouncementRejectsMalformed(t *testing.T) {
+	if _, _, ok := decodeAnnouncement([]byte("not-a-valid-announcement")); ok {
+		t.Fatalf("expected malformed announcement to be rejected")
+	}
+}
+
+func TestMulticastDiscoveryCloseStopsLoops(t *testing.T) {
+	d, err := NewMulticastDiscovery()
+	if err != nil {
+		t.Skipf("multicast unavailable in this environment: %v", err)
+	}
+	md := d.(*multicastDiscovery)
+
+	if err := md.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// Close must be idempotent.
+	if err := md.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+
+	md.mu.Lock()
+	closed := md.closed
+	md.mu.Unlock()
+	if !closed {
+		t.Fatal("expected closed flag to be set after Close")
+	}
+
+	if err := md.send("svc", "vaddr:1", nil); err == nil {
+		t.Fatal("expected send on a closed conn to fail")
+	}
+}
+
+// TestMulticastDiscoveryDeliverDoesNotRaceUnsubscribe replays deliver (what
+// readLoop calls on every incoming announcement) racing against Resolve's
+// unsubscribe goroutine closing the same subscriber channel. Before deliver
+// and the unsubscribe close shared a lock, this could send on an
+// already-closed channel and panic; run with -race to also catch the
+// unsynchronized access. No real socket/network is needed, since deliver and
+// Resolve don't touch d.conn.
+func TestMulticastDiscoveryDeliverDoesNotRaceUnsubscribe(t *testing.T) {
+	d := &multicastDiscovery{subscribers: make(map[string][]chan Endpoint)}
+
+	for i := 0; i < 500; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		ch, err := d.Resolve(ctx, "svc")
+		if err != nil {
+			t.Fatalf("Resolve: %v", err)
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cancel()
+		}()
+		go func() {
+			defer wg.Done()
+			d.deliver("svc", Endpoint{VAddr: "vaddr:1"})
+		}()
+		wg.Wait()
+
+		for range ch {
+		}
+	}
+}
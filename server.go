@@ -0,0 +1,133 @@
+package chanserv
+
+import (
+	"context"
+	"encoding/gob"
+	"net"
+	"time"
+)
+
+// netServer is the concrete Server implementation: it binds vAddr on a
+// Multiplexer, decodes each connection's subscribeRequest handshake, and
+// streams the resulting Sources back over the wire using wireMsg frames.
+type netServer struct {
+	mux  Multiplexer
+	opts *serverOptions
+}
+
+// NewServer returns a Server backed by mux. See the With* ServerOptions in
+// this package for optional behaviour (accept backoff metrics, service
+// discovery, frame codecs).
+func NewServer(mux Multiplexer, opts ...ServerOption) Server {
+	return &netServer{mux: mux, opts: newServerOptions(opts...)}
+}
+
+func (s *netServer) ListenAndServe(vAddr string, src SourceFunc) error {
+	return s.ServeContext(context.Background(), vAddr, func(ctx context.Context, body []byte) <-chan Source {
+		return src(body)
+	})
+}
+
+func (s *netServer) ServeContext(ctx context.Context, vAddr string, src SourceCtxFunc) error {
+	l, err := s.mux.Bind(defaultNetwork, vAddr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	if s.opts.discovery != nil {
+		if err := s.opts.discovery.Register(s.opts.discoveryService, vAddr, nil); err != nil {
+			return err
+		}
+		defer s.opts.discovery.Deregister(s.opts.discoveryService, vAddr)
+	}
+
+	// Accept blocks on the listener alone, so ctx being cancelled needs its
+	// own trigger to unblock it; closing l does that and makes Accept return
+	// an error, which the ctx.Err() check below turns into a clean shutdown.
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	var delay time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			delay, err = handleAcceptErr(ctx, err, delay, s.opts.onAcceptDelay)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		delay = 0
+		go s.handleConn(ctx, conn, src)
+	}
+}
+
+// handleConn services a single subscription end to end: handshake, codec
+// negotiation, and streaming Sources until src's channel closes or ctx is
+// cancelled.
+func (s *netServer) handleConn(ctx context.Context, conn net.Conn, src SourceCtxFunc) {
+	defer conn.Close()
+
+	connCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dec := gob.NewDecoder(conn)
+	enc := gob.NewEncoder(conn)
+
+	var req subscribeRequest
+	if err := dec.Decode(&req); err != nil {
+		return
+	}
+
+	codecName, chosen := negotiateCodec(parseCodecPreference(req.Tags[TagCodecPreference]), availableCodecs(s.opts.codecs))
+	if err := enc.Encode(subscribeResponseHeader{Codec: codecName}); err != nil {
+		return
+	}
+
+	// The client sends nothing after its subscribeRequest, so a Read on conn
+	// only returns once the client disconnects (or conn is closed here); that
+	// cancels connCtx so src can stop producing frames nobody will receive.
+	go func() {
+		var b [1]byte
+		conn.Read(b[:])
+		cancel()
+	}()
+
+	// Cancellation (the server's own ctx, the client disconnecting, or
+	// connCtx being cancelled once handleConn returns) must unblock a send
+	// that's stuck writing to conn.
+	go func() {
+		<-connCtx.Done()
+		conn.Close()
+	}()
+
+	for source := range src(connCtx, req.Body) {
+		if err := enc.Encode(wireMsg{Kind: msgSourceStart, Bytes: source.Header()}); err != nil {
+			return
+		}
+		for frame := range source.Out() {
+			payload, err := chosen.enc.Encode(frame.Bytes())
+			if err != nil {
+				return
+			}
+			if err := enc.Encode(wireMsg{Kind: msgFrameData, Bytes: payload}); err != nil {
+				return
+			}
+		}
+		if err := enc.Encode(wireMsg{Kind: msgSourceEnd}); err != nil {
+			return
+		}
+	}
+
+	if err := connCtx.Err(); err != nil {
+		enc.Encode(wireMsg{Kind: msgStreamErr, ErrMsg: err.Error()})
+		return
+	}
+	enc.Encode(wireMsg{Kind: msgStreamEnd})
+}
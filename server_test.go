@@ -0,0 +1,655 @@
+package chanserv
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// dialUntilBound retries LookupAndPostContext for a short while: ServeContext
+// binds its listener in the same goroutine that runs it, so a test that
+// starts the server with `go` has no other signal that Bind has happened yet.
+func dialUntilBound(t *testing.T, cli Client, ctx context.Context, vAddr string, body []byte, tags map[RequestTag]string) <-chan ErrSource {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		sources, err := cli.LookupAndPostContext(ctx, vAddr, body, tags)
+		if err == nil {
+			return sources
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("LookupAndPostContext: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type testFrame []byte
+
+func (f testFrame) Bytes() []byte { return []byte(f) }
+
+// testSource is a minimal Source implementation used by SourceCtxFuncs in
+// these tests: frames is drained onto Out(), which is then closed.
+type testSource struct {
+	header []byte
+	frames [][]byte
+}
+
+func (s testSource) Header() []byte { return s.header }
+func (s testSource) Meta() MetaData { return nil }
+func (s testSource) Out() <-chan Frame {
+	out := make(chan Frame, len(s.frames))
+	for _, f := range s.frames {
+		out <- testFrame(f)
+	}
+	close(out)
+	return out
+}
+
+func TestNetServerClientRoundTrip(t *testing.T) {
+	mux := NewInprocMux()
+	srv := NewServer(mux)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ServeContext(ctx, "svc:echo", func(_ context.Context, body []byte) <-chan Source {
+			out := make(chan Source, 1)
+			out <- testSource{header: []byte("hdr"), frames: [][]byte{body, []byte("second")}}
+			close(out)
+			return out
+		})
+	}()
+
+	cli := NewClient(mux)
+	sources := dialUntilBound(t, cli, context.Background(), "svc:echo", []byte("hello"), nil)
+
+	src, ok := <-sources
+	if !ok {
+		t.Fatal("expected a Source, got closed channel")
+	}
+	if string(src.Header()) != "hdr" {
+		t.Fatalf("Header() = %q, want %q", src.Header(), "hdr")
+	}
+
+	var got [][]byte
+	for f := range src.Out() {
+		got = append(got, f.Bytes())
+	}
+	if len(got) != 2 || string(got[0]) != "hello" || string(got[1]) != "second" {
+		t.Fatalf("unexpected frames: %q", got)
+	}
+	if err := src.Err(); err != nil {
+		t.Fatalf("Err() = %v, want nil", err)
+	}
+
+	if _, ok := <-sources; ok {
+		t.Fatal("expected sources channel to close after the single Source")
+	}
+
+	cancel()
+	if err := <-serveErr; err != context.Canceled {
+		t.Fatalf("ServeContext returned %v, want context.Canceled", err)
+	}
+}
+
+// blockingSource never sends or closes its Out() channel on its own, so the
+// server connection stays open until something external unblocks it.
+type blockingSource struct {
+	header []byte
+	out    chan Frame
+}
+
+func (s blockingSource) Header() []byte    { return s.header }
+func (s blockingSource) Meta() MetaData    { return nil }
+func (s blockingSource) Out() <-chan Frame { return s.out }
+
+func TestNetClientContextCancellationClosesSourceWithErr(t *testing.T) {
+	mux := NewInprocMux()
+	srv := NewServer(mux)
+
+	srvCtx, srvCancel := context.WithCancel(context.Background())
+	defer srvCancel()
+
+	frameCh := make(chan Frame)
+	go srv.ServeContext(srvCtx, "svc:block", func(ctx context.Context, body []byte) <-chan Source {
+		out := make(chan Source, 1)
+		out <- blockingSource{header: []byte("hdr"), out: frameCh}
+		close(out)
+		return out
+	})
+
+	cli := NewClient(mux)
+	clientCtx, clientCancel := context.WithCancel(context.Background())
+
+	sources := dialUntilBound(t, cli, clientCtx, "svc:block", nil, nil)
+
+	src := <-sources
+	clientCancel()
+
+	select {
+	case _, ok := <-src.Out():
+		if ok {
+			t.Fatal("expected Out() to close, got a frame")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Out() did not close after client ctx cancellation")
+	}
+	if err := src.Err(); err != context.Canceled {
+		t.Fatalf("Err() = %v, want context.Canceled", err)
+	}
+	close(frameCh)
+}
+
+func TestNetServerServeContextCancellationPropagatesToSourceFunc(t *testing.T) {
+	mux := NewInprocMux()
+	srv := NewServer(mux)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	reached := make(chan struct{})
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ServeContext(ctx, "svc:cancel", func(ctx context.Context, body []byte) <-chan Source {
+			close(reached)
+			<-ctx.Done()
+			out := make(chan Source)
+			close(out)
+			return out
+		})
+	}()
+
+	cli := NewClient(mux)
+	sources := dialUntilBound(t, cli, context.Background(), "svc:cancel", nil, nil)
+
+	select {
+	case <-reached:
+	case <-time.After(time.Second):
+		t.Fatal("server's SourceCtxFunc was never invoked")
+	}
+
+	cancel()
+
+	if err := <-serveErr; err != context.Canceled {
+		t.Fatalf("ServeContext returned %v, want context.Canceled", err)
+	}
+
+	select {
+	case _, ok := <-sources:
+		if ok {
+			t.Fatal("expected client's sources channel to close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("client sources channel never closed after server shutdown")
+	}
+}
+
+func TestNetClientLookupServiceWithoutDiscoveryErrors(t *testing.T) {
+	cli := NewClient(NewInprocMux())
+	if _, err := cli.LookupService(context.Background(), "anything"); err == nil {
+		t.Fatal("expected an error when no Discovery is configured")
+	} else if errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// fakeDiscovery is an in-memory Discovery used to test wiring deterministically,
+// without depending on mDNS/UDP multicast being available in the test environment.
+type fakeDiscovery struct {
+	mu           sync.Mutex
+	registered   []Endpoint
+	deregistered []Endpoint
+	resolve      chan Endpoint
+}
+
+func newFakeDiscovery() *fakeDiscovery {
+	return &fakeDiscovery{resolve: make(chan Endpoint, 1)}
+}
+
+func (d *fakeDiscovery) Register(service, vAddr string, meta map[string]string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.registered = append(d.registered, Endpoint{VAddr: vAddr, Meta: meta})
+	return nil
+}
+
+func (d *fakeDiscovery) Deregister(service, vAddr string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deregistered = append(d.deregistered, Endpoint{VAddr: vAddr})
+	return nil
+}
+
+func (d *fakeDiscovery) Resolve(ctx context.Context, service string) (<-chan Endpoint, error) {
+	out := make(chan Endpoint)
+	go func() {
+		defer close(out)
+		select {
+		case ep := <-d.resolve:
+			select {
+			case out <- ep:
+			case <-ctx.Done():
+			}
+		case <-ctx.Done():
+		}
+	}()
+	return out, nil
+}
+
+func (d *fakeDiscovery) Close() error { return nil }
+
+func TestNetServerRegistersAndDeregistersWithDiscovery(t *testing.T) {
+	disc := newFakeDiscovery()
+	mux := NewInprocMux()
+	srv := NewServer(mux, WithDiscovery(disc, "echo"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ServeContext(ctx, "svc:discovered", func(_ context.Context, _ []byte) <-chan Source {
+			out := make(chan Source)
+			close(out)
+			return out
+		})
+	}()
+
+	cli := NewClient(mux)
+	sources := dialUntilBound(t, cli, context.Background(), "svc:discovered", nil, nil)
+	<-sources
+
+	disc.mu.Lock()
+	registered := append([]Endpoint(nil), disc.registered...)
+	disc.mu.Unlock()
+	if len(registered) != 1 || registered[0].VAddr != "svc:discovered" {
+		t.Fatalf("expected Register(_, %q, _) exactly once, got %+v", "svc:discovered", registered)
+	}
+
+	cancel()
+	if err := <-serveErr; err != context.Canceled {
+		t.Fatalf("ServeContext returned %v, want context.Canceled", err)
+	}
+
+	disc.mu.Lock()
+	deregistered := append([]Endpoint(nil), disc.deregistered...)
+	disc.mu.Unlock()
+	if len(deregistered) != 1 || deregistered[0].VAddr != "svc:discovered" {
+		t.Fatalf("expected Deregister(_, %q) on shutdown, got %+v", "svc:discovered", deregistered)
+	}
+}
+
+// prefixCodec is a FrameEncoder/FrameDecoder used to prove a negotiated codec
+// (not just "identity") actually runs on both ends of the wire: Encode
+// prepends a marker byte, Decode requires and strips it.
+type prefixCodec struct{ marker byte }
+
+func (c prefixCodec) Encode(p []byte) ([]byte, error) {
+	return append([]byte{c.marker}, p...), nil
+}
+
+func (c prefixCodec) Decode(p []byte) ([]byte, error) {
+	if len(p) == 0 || p[0] != c.marker {
+		return nil, errors.New("prefixCodec: missing marker byte")
+	}
+	return p[1:], nil
+}
+
+func TestNetServerClientNegotiatesNonIdentityCodec(t *testing.T) {
+	mux := NewInprocMux()
+	marked := WithFrameCodec("marked", prefixCodec{marker: 0x7f}, prefixCodec{marker: 0x7f})
+
+	srv := NewServer(mux, marked)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ServeContext(ctx, "svc:codec", func(_ context.Context, body []byte) <-chan Source {
+			out := make(chan Source, 1)
+			out <- testSource{header: []byte("hdr"), frames: [][]byte{body}}
+			close(out)
+			return out
+		})
+	}()
+
+	cli := NewClient(mux, marked)
+	sources := dialUntilBound(t, cli, context.Background(), "svc:codec", []byte("payload"), map[RequestTag]string{
+		TagCodecPreference: "marked",
+	})
+
+	src := <-sources
+	frame := <-src.Out()
+	if string(frame.Bytes()) != "payload" {
+		t.Fatalf("frame = %q, want %q", frame.Bytes(), "payload")
+	}
+
+	cancel()
+	<-serveErr
+}
+
+func TestNetClientLookupServiceForwardsToDiscoveryResolve(t *testing.T) {
+	disc := newFakeDiscovery()
+	cli := NewClient(NewInprocMux(), WithDiscovery(disc, "echo"))
+
+	disc.resolve <- Endpoint{VAddr: "vaddr:9"}
+
+	endpoints, err := cli.LookupService(context.Background(), "echo")
+	if err != nil {
+		t.Fatalf("LookupService: %v", err)
+	}
+
+	ep, ok := <-endpoints
+	if !ok {
+		t.Fatal("expected an Endpoint, got closed channel")
+	}
+	if ep.VAddr != "vaddr:9" {
+		t.Fatalf("VAddr = %q, want %q", ep.VAddr, "vaddr:9")
+	}
+}
+
+// flakyAcceptListener fails the first failCount Accept calls with a
+// temporary net.Error before delegating to the real listener.
+type flakyAcceptListener struct {
+	net.Listener
+	failCount int
+}
+
+func (l *flakyAcceptListener) Accept() (net.Conn, error) {
+	if l.failCount > 0 {
+		l.failCount--
+		return nil, fakeNetErr{temporary: true}
+	}
+	return l.Listener.Accept()
+}
+
+// flakyMux wraps a Multiplexer so the listener its Bind returns fails its
+// first few Accept calls, exercising ServeContext's accept-retry backoff.
+type flakyMux struct {
+	Multiplexer
+	failCount int
+}
+
+func (m *flakyMux) Bind(network, laddr string) (net.Listener, error) {
+	l, err := m.Multiplexer.Bind(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+	return &flakyAcceptListener{Listener: l, failCount: m.failCount}, nil
+}
+
+func TestNetServerServeContextRetriesAcceptWithBackoff(t *testing.T) {
+	mux := &flakyMux{Multiplexer: NewInprocMux(), failCount: 3}
+
+	var delays []time.Duration
+	var mu sync.Mutex
+	srv := NewServer(mux, WithAcceptDelayMetric(func(d time.Duration) {
+		mu.Lock()
+		delays = append(delays, d)
+		mu.Unlock()
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ServeContext(ctx, "svc:flaky", func(_ context.Context, body []byte) <-chan Source {
+			out := make(chan Source)
+			close(out)
+			return out
+		})
+	}()
+
+	cli := NewClient(mux)
+	sources := dialUntilBound(t, cli, context.Background(), "svc:flaky", nil, nil)
+	if _, ok := <-sources; ok {
+		t.Fatal("expected sources channel to close immediately for an empty SourceCtxFunc")
+	}
+
+	mu.Lock()
+	got := len(delays)
+	mu.Unlock()
+	if got != 3 {
+		t.Fatalf("expected onAcceptDelay to fire 3 times (once per flaky Accept), got %d", got)
+	}
+
+	cancel()
+	if err := <-serveErr; err != context.Canceled {
+		t.Fatalf("ServeContext returned %v, want context.Canceled", err)
+	}
+}
+
+// slowBackend returns a SourceCtxFunc that waits out d (or ctx cancellation,
+// whichever comes first) before yielding a single Source, modelling a hedge
+// candidate that is slower to produce an answer than its peers.
+func slowBackend(d time.Duration, header string) SourceCtxFunc {
+	return func(ctx context.Context, body []byte) <-chan Source {
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+		}
+		out := make(chan Source, 1)
+		out <- testSource{header: []byte(header), frames: [][]byte{body}}
+		close(out)
+		return out
+	}
+}
+
+func TestNetClientHedgedLookupAndPostPicksFastestResponder(t *testing.T) {
+	mux := NewInprocMux()
+
+	slowDelay := 300 * time.Millisecond
+	go NewServer(mux).ServeContext(context.Background(), "slow:0", slowBackend(slowDelay, "slow"))
+	go NewServer(mux).ServeContext(context.Background(), "fast:0", func(_ context.Context, body []byte) <-chan Source {
+		out := make(chan Source, 1)
+		out <- testSource{header: []byte("fast"), frames: [][]byte{body}}
+		close(out)
+		return out
+	})
+
+	cli := NewClient(mux)
+	dialUntilBound(t, cli, context.Background(), "slow:0", nil, nil)
+	dialUntilBound(t, cli, context.Background(), "fast:0", nil, nil)
+
+	start := time.Now()
+	sources, err := cli.LookupAndPostContext(context.Background(), "slow:0,fast:0", []byte("payload"), map[RequestTag]string{
+		TagHedge: "2",
+	})
+	if err != nil {
+		t.Fatalf("LookupAndPostContext: %v", err)
+	}
+
+	src, ok := <-sources
+	if !ok {
+		t.Fatal("expected a winning Source, got closed channel")
+	}
+	if elapsed := time.Since(start); elapsed >= slowDelay {
+		t.Fatalf("winning Source took %v, expected well under the slow backend's %v delay", elapsed, slowDelay)
+	}
+	if string(src.Header()) != "fast" {
+		t.Fatalf("Header() = %q, want %q (expected the fast backend to win)", src.Header(), "fast")
+	}
+	frame := <-src.Out()
+	if string(frame.Bytes()) != "payload" {
+		t.Fatalf("frame = %q, want %q", frame.Bytes(), "payload")
+	}
+}
+
+func TestHedgeCandidatesCyclesShorterAddressList(t *testing.T) {
+	got := hedgeCandidates("a,b", 3)
+	want := []string{"a", "b", "a"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("hedgeCandidates(%q, 3) = %v, want %v", "a,b", got, want)
+		}
+	}
+}
+
+func TestHedgeCountDefaultsToOneForMissingOrInvalidTag(t *testing.T) {
+	if n := hedgeCount(nil); n != 1 {
+		t.Fatalf("hedgeCount(nil) = %d, want 1", n)
+	}
+	if n := hedgeCount(map[RequestTag]string{TagHedge: "not-a-number"}); n != 1 {
+		t.Fatalf("hedgeCount with invalid tag = %d, want 1", n)
+	}
+	if n := hedgeCount(map[RequestTag]string{TagHedge: "4"}); n != 4 {
+		t.Fatalf("hedgeCount with TagHedge=4 = %d, want 4", n)
+	}
+}
+
+func TestNetClientLookupAndPostContextWithSubscriptionReportsWinner(t *testing.T) {
+	mux := NewInprocMux()
+
+	slowDelay := 300 * time.Millisecond
+	go NewServer(mux).ServeContext(context.Background(), "slow:0", slowBackend(slowDelay, "slow"))
+	go NewServer(mux).ServeContext(context.Background(), "fast:0", func(_ context.Context, body []byte) <-chan Source {
+		out := make(chan Source, 1)
+		out <- testSource{header: []byte("fast"), frames: [][]byte{body}}
+		close(out)
+		return out
+	})
+
+	cli := NewClient(mux)
+	dialUntilBound(t, cli, context.Background(), "slow:0", nil, nil)
+	dialUntilBound(t, cli, context.Background(), "fast:0", nil, nil)
+
+	sources, sub, err := cli.LookupAndPostContextWithSubscription(context.Background(), "slow:0,fast:0", []byte("payload"), map[RequestTag]string{
+		TagHedge: "2",
+	})
+	if err != nil {
+		t.Fatalf("LookupAndPostContextWithSubscription: %v", err)
+	}
+	if sub == nil {
+		t.Fatal("expected a non-nil Subscription for a hedged request")
+	}
+
+	src, ok := <-sources
+	if !ok {
+		t.Fatal("expected a winning Source, got closed channel")
+	}
+	for range src.Out() {
+	}
+	for range sources {
+	}
+
+	if sub.Winner != 1 {
+		t.Fatalf("Subscription.Winner = %d, want 1 (the fast:0 candidate)", sub.Winner)
+	}
+	if len(sub.Errs) != 1 {
+		t.Fatalf("Subscription.Errs = %v, want exactly one entry for the cancelled slow:0 attempt", sub.Errs)
+	}
+}
+
+func TestNetClientLookupAndPostContextWithSubscriptionNilWhenNotHedged(t *testing.T) {
+	mux := NewInprocMux()
+	go NewServer(mux).ServeContext(context.Background(), "echo:0", func(_ context.Context, body []byte) <-chan Source {
+		out := make(chan Source, 1)
+		out <- testSource{header: []byte("echo"), frames: [][]byte{body}}
+		close(out)
+		return out
+	})
+
+	cli := NewClient(mux)
+	dialUntilBound(t, cli, context.Background(), "echo:0", nil, nil)
+
+	sources, sub, err := cli.LookupAndPostContextWithSubscription(context.Background(), "echo:0", []byte("payload"), nil)
+	if err != nil {
+		t.Fatalf("LookupAndPostContextWithSubscription: %v", err)
+	}
+	if sub != nil {
+		t.Fatalf("Subscription = %+v, want nil for a non-hedged request", sub)
+	}
+	<-sources
+}
+
+// TestNetClientContextCancellationWhileBlockedOnFrameClosesSourceWithErr
+// covers cancellation after a frame has already been decoded and readLoop is
+// blocked handing it to current.out (unlike
+// TestNetClientContextCancellationClosesSourceWithErr, which cancels before
+// any frame arrives). Out() must still close with ctx.Err(), not hang.
+func TestNetClientContextCancellationWhileBlockedOnFrameClosesSourceWithErr(t *testing.T) {
+	mux := NewInprocMux()
+	srv := NewServer(mux)
+
+	srvCtx, srvCancel := context.WithCancel(context.Background())
+	defer srvCancel()
+
+	frameCh := make(chan Frame)
+	go srv.ServeContext(srvCtx, "svc:block-frame", func(ctx context.Context, body []byte) <-chan Source {
+		out := make(chan Source, 1)
+		out <- blockingSource{header: []byte("hdr"), out: frameCh}
+		close(out)
+		return out
+	})
+
+	cli := NewClient(mux)
+	clientCtx, clientCancel := context.WithCancel(context.Background())
+
+	sources := dialUntilBound(t, cli, clientCtx, "svc:block-frame", nil, nil)
+	src := <-sources
+
+	frameCh <- testFrame("payload")
+	// Give readLoop time to decode the frame and block handing it to
+	// src.Out(), which nothing is draining yet.
+	time.Sleep(50 * time.Millisecond)
+	clientCancel()
+
+	select {
+	case _, ok := <-src.Out():
+		if ok {
+			t.Fatal("expected Out() to close, got a frame")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Out() did not close after client ctx cancellation while blocked on a frame")
+	}
+	if err := src.Err(); err != context.Canceled {
+		t.Fatalf("Err() = %v, want context.Canceled", err)
+	}
+	close(frameCh)
+}
+
+func TestHedgeAttemptSourcesStopsForwardingOnceAbandoned(t *testing.T) {
+	sources := make(chan ErrSource, 3)
+	sources <- newClientSource([]byte("first"), "addr:1")
+	sources <- newClientSource([]byte("second"), "addr:1")
+	sources <- newClientSource([]byte("third"), "addr:1")
+
+	attemptCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out, err := hedgeAttemptSources(attemptCtx, sources)
+	if err != nil {
+		t.Fatalf("hedgeAttemptSources: %v", err)
+	}
+
+	// Mimic a losing hedge attempt: take the first (buffered) Source, as
+	// mergeSources does before learning it lost the race, then stop reading
+	// out entirely. The forwarding goroutine should still pick up "second"
+	// and "third" from sources and try to hand them off, landing one of
+	// those sends stuck on out's full buffer.
+	<-out
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	// Whatever was already buffered by the time cancel() fired (e.g.
+	// "second") is fine to still observe; what must not happen is out
+	// staying open forever because the forwarding goroutine is stuck
+	// handing off "third" to a buffer nobody is draining anymore.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for range out {
+		}
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("out did not close after attemptCtx cancellation; forwarding goroutine leaked")
+	}
+}
@@ -0,0 +1,95 @@
+package chanserv
+
+import "sync"
+
+// defaultNetwork is the network name chanserv passes to Multiplexer.Bind and
+// Multiplexer.DialTimeout. It has no meaning beyond identifying chanserv
+// traffic to Multiplexer implementations that care (NewInprocMux ignores it).
+const defaultNetwork = "chanserv"
+
+// subscribeRequest is the handshake a Client sends immediately after
+// dialling vAddr: the request body and tags LookupAndPost(Context) was
+// called with.
+type subscribeRequest struct {
+	Body []byte
+	Tags map[RequestTag]string
+}
+
+// subscribeResponseHeader is the handshake a Server sends back once it has
+// decoded a subscribeRequest: the codec it chose to encode every subsequent
+// msgFrameData payload with.
+type subscribeResponseHeader struct {
+	Codec string
+}
+
+// wireMsgKind tags the variants of wireMsg exchanged after the handshake.
+type wireMsgKind uint8
+
+const (
+	// msgSourceStart announces a new Source; Bytes carries its Header().
+	msgSourceStart wireMsgKind = iota
+	// msgFrameData carries one codec-encoded Frame.Bytes() belonging to the
+	// most recently started Source.
+	msgFrameData
+	// msgSourceEnd closes the Out() channel of the most recently started Source.
+	msgSourceEnd
+	// msgStreamEnd marks a clean end of the subscription: the SourceFunc's
+	// channel closed without the context being cancelled.
+	msgStreamEnd
+	// msgStreamErr marks the subscription ending because the server's context
+	// was cancelled; ErrMsg carries the reason.
+	msgStreamErr
+)
+
+type wireMsg struct {
+	Kind   wireMsgKind
+	Bytes  []byte
+	ErrMsg string
+}
+
+// byteFrame is the concrete Frame used to hand decoded wire payloads back to
+// a Client caller.
+type byteFrame []byte
+
+func (f byteFrame) Bytes() []byte { return []byte(f) }
+
+// clientMetaData is the MetaData chanserv attaches to every Source it
+// delivers to a Client, per the MetaData doc comment.
+type clientMetaData struct {
+	remoteAddr string
+}
+
+func (m clientMetaData) RemoteAddr() string { return m.remoteAddr }
+
+// clientSource is the ErrSource implementation fed by a Client's readLoop.
+type clientSource struct {
+	header []byte
+	meta   MetaData
+	out    chan Frame
+
+	mu  sync.Mutex
+	err error
+}
+
+func newClientSource(header []byte, remoteAddr string) *clientSource {
+	return &clientSource{header: header, meta: clientMetaData{remoteAddr: remoteAddr}, out: make(chan Frame)}
+}
+
+func (s *clientSource) Header() []byte    { return s.header }
+func (s *clientSource) Meta() MetaData    { return s.meta }
+func (s *clientSource) Out() <-chan Frame { return s.out }
+
+func (s *clientSource) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// finish records err as the reason Out() is closing, then closes it. It must
+// be called at most once.
+func (s *clientSource) finish(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	close(s.out)
+}